@@ -4,35 +4,166 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"net/http"
+	"runtime"
 	"sort"
 	"strings"
 	"sync"
 	"text/tabwriter"
+	"text/template"
 	"time"
 
 	"github.com/docker/docker/api/types"
-	flag "github.com/docker/docker/pkg/mflag"
 	"github.com/docker/docker/pkg/units"
 )
 
 type containerStats struct {
 	Name             string
+	ID               string
 	CPUPercentage    float64
 	Memory           float64
 	MemoryLimit      float64
 	MemoryPercentage float64
 	NetworkRx        float64
 	NetworkTx        float64
+	BlockRead        float64
+	BlockWrite       float64
+	PidsCurrent      uint64
+	unavailable      bool
 	mu               sync.RWMutex
 	err              error
 }
 
-func (s *containerStats) Collect(cli *DockerCli) {
-	stream, _, err := cli.call("GET", "/containers/"+s.Name+"/stats", nil, nil)
-	if err != nil {
-		s.err = err
-		return
+// stats is a mutex-guarded registry of the containerStats currently being displayed.
+type stats struct {
+	mu sync.Mutex
+	cs []*containerStats
+}
+
+// daemonOSType lets Collect pick the matching CPU% formula; set once from
+// the OSType field of the first stats response successfully decoded. Guarded
+// by daemonOSTypeMu since a decode goroutine runs per monitored container.
+var (
+	daemonOSTypeMu sync.RWMutex
+	daemonOSType   string
+)
+
+func getDaemonOSType() string {
+	daemonOSTypeMu.RLock()
+	defer daemonOSTypeMu.RUnlock()
+	return daemonOSType
+}
+
+func setDaemonOSTypeOnce(osType string) {
+	daemonOSTypeMu.Lock()
+	defer daemonOSTypeMu.Unlock()
+	if daemonOSType == "" {
+		daemonOSType = osType
+	}
+}
+
+func (s *stats) add(cs *containerStats) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, exists := s.isKnownContainer(cs.Name); !exists {
+		s.cs = append(s.cs, cs)
+		return true
 	}
+	return false
+}
+
+func (s *stats) remove(id string) {
+	s.mu.Lock()
+	if i, exists := s.isKnownContainer(id); exists {
+		s.cs = append(s.cs[:i], s.cs[i+1:]...)
+	}
+	s.mu.Unlock()
+}
+
+// isKnownContainer matches cid against either the registry key a
+// containerStats was added under or its resolved container ID, so a
+// container added by name (explicit CLI args) is still recognized when an
+// events callback later refers to it by ID.
+func (s *stats) isKnownContainer(cid string) (int, bool) {
+	for i, c := range s.cs {
+		if c.Name == cid || (c.ID != "" && c.ID == cid) {
+			return i, true
+		}
+	}
+	return -1, false
+}
+
+// nameFor returns the registry key a known container was added under, so
+// callers that only have its ID (from an events callback) can still look up
+// its done channel, which is keyed by that same registration name.
+func (s *stats) nameFor(cid string) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if i, exists := s.isKnownContainer(cid); exists {
+		return s.cs[i].Name, true
+	}
+	return "", false
+}
+
+func (s *stats) list() []*containerStats {
+	s.mu.Lock()
+	cs := make([]*containerStats, len(s.cs))
+	copy(cs, s.cs)
+	s.mu.Unlock()
+	return cs
+}
+
+// Collect subscribes to the container's stats stream and keeps s updated
+// until done is closed, retrying the subscription (and marking s
+// unavailable in the meantime) while the container isn't running.
+func (s *containerStats) Collect(cli *DockerCli, done <-chan bool, rawMemory bool) {
+	for {
+		stream, statusCode, err := cli.call("GET", "/containers/"+s.Name+"/stats", nil, nil)
+		if err != nil {
+			if isNotRunningErr(err, statusCode) {
+				s.mu.Lock()
+				s.unavailable = true
+				s.mu.Unlock()
+				select {
+				case <-done:
+					return
+				case <-time.After(1 * time.Second):
+					continue
+				}
+			}
+			s.mu.Lock()
+			s.err = err
+			s.mu.Unlock()
+			return
+		}
+		s.mu.Lock()
+		s.unavailable = false
+		s.mu.Unlock()
+		if stop := s.collectStream(stream, done, rawMemory); stop {
+			return
+		}
+		// the stream ended because the container stopped; mark it
+		// unavailable and retry so a later restart is picked up.
+		s.mu.Lock()
+		s.unavailable = true
+		s.mu.Unlock()
+		select {
+		case <-done:
+			return
+		case <-time.After(1 * time.Second):
+		}
+	}
+}
+
+// isNotRunningErr reports whether err represents a container that exists
+// but isn't currently running, as opposed to one that can't be resolved.
+func isNotRunningErr(err error, statusCode int) bool {
+	return statusCode == 409 || strings.Contains(err.Error(), "is not running")
+}
+
+// collectStream decodes stats off stream until it ends or done is closed. It
+// returns true if the caller should stop entirely, false to retry.
+func (s *containerStats) collectStream(stream io.ReadCloser, done <-chan bool, rawMemory bool) bool {
 	defer stream.Close()
 	var (
 		previousCPU    uint64
@@ -48,29 +179,52 @@ func (s *containerStats) Collect(cli *DockerCli) {
 				u <- err
 				return
 			}
+			if v.OSType != "" {
+				setDaemonOSTypeOnce(v.OSType)
+			}
+			osType := getDaemonOSType()
+			memUsage := float64(v.MemoryStats.Usage)
+			if !rawMemory && osType != "windows" {
+				memUsage = calculateMemUsageUnixNoCache(v.MemoryStats)
+			}
 			var (
-				memPercent = float64(v.MemoryStats.Usage) / float64(v.MemoryStats.Limit) * 100.0
+				memPercent = memUsage / float64(v.MemoryStats.Limit) * 100.0
 				cpuPercent = 0.0
 			)
 			if !start {
-				cpuPercent = calculateCPUPercent(previousCPU, previousSystem, v)
+				if osType == "windows" {
+					cpuPercent = calculateCPUPercentWindows(previousCPU, previousSystem, &v.CpuStats)
+				} else {
+					cpuPercent = calculateCPUPercentUnix(previousCPU, previousSystem, &v.CpuStats)
+				}
 			}
+			blkRead, blkWrite := calculateBlockIO(v.BlkioStats)
 			start = false
 			s.mu.Lock()
 			s.CPUPercentage = cpuPercent
-			s.Memory = float64(v.MemoryStats.Usage)
+			s.Memory = memUsage
 			s.MemoryLimit = float64(v.MemoryStats.Limit)
 			s.MemoryPercentage = memPercent
 			s.NetworkRx = float64(v.Network.RxBytes)
 			s.NetworkTx = float64(v.Network.TxBytes)
+			s.BlockRead = float64(blkRead)
+			s.BlockWrite = float64(blkWrite)
+			s.PidsCurrent = v.PidsStats.Current
 			s.mu.Unlock()
-			previousCPU = v.CpuStats.CpuUsage.TotalUsage
-			previousSystem = v.CpuStats.SystemUsage
+			if osType == "windows" {
+				previousCPU = v.CpuStats.KernelTime + v.CpuStats.UserTime
+				previousSystem = v.CpuStats.ReadTime
+			} else {
+				previousCPU = v.CpuStats.CpuUsage.TotalUsage
+				previousSystem = v.CpuStats.SystemUsage
+			}
 			u <- nil
 		}
 	}()
 	for {
 		select {
+		case <-done:
+			return true
 		case <-time.After(2 * time.Second):
 			// zero out the values if we have not received an update within
 			// the specified duration.
@@ -81,101 +235,446 @@ func (s *containerStats) Collect(cli *DockerCli) {
 			s.mu.Unlock()
 		case err := <-u:
 			if err != nil {
-				s.mu.Lock()
-				s.err = err
-				s.mu.Unlock()
-				return
+				return false
 			}
 		}
 	}
 }
 
-func (s *containerStats) Display(w io.Writer) error {
+// statsFields is the set of named fields a StatsFormatter has available.
+type statsFields struct {
+	Name     string `json:"name"`
+	CPUPerc  string `json:"cpu_perc"`
+	MemUsage string `json:"mem_usage"`
+	MemPerc  string `json:"mem_perc"`
+	NetIO    string `json:"net_io"`
+	BlockIO  string `json:"block_io"`
+	PIDs     string `json:"pids"`
+}
+
+// fields returns a snapshot of s as statsFields, or an error if the
+// container's stats stream has failed.
+func (s *containerStats) fields() (statsFields, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 	if s.err != nil {
-		return s.err
+		return statsFields{}, s.err
+	}
+	if s.unavailable {
+		return statsFields{
+			Name:     s.Name,
+			CPUPerc:  "--",
+			MemUsage: "--/--",
+			MemPerc:  "--",
+			NetIO:    "--/--",
+			BlockIO:  "--/--",
+			PIDs:     "--",
+		}, nil
+	}
+	return statsFields{
+		Name:     s.Name,
+		CPUPerc:  fmt.Sprintf("%.2f%%", s.CPUPercentage),
+		MemUsage: fmt.Sprintf("%s/%s", units.HumanSize(s.Memory), units.HumanSize(s.MemoryLimit)),
+		MemPerc:  fmt.Sprintf("%.2f%%", s.MemoryPercentage),
+		NetIO:    fmt.Sprintf("%s/%s", units.HumanSize(s.NetworkRx), units.HumanSize(s.NetworkTx)),
+		BlockIO:  fmt.Sprintf("%s/%s", units.HumanSize(s.BlockRead), units.HumanSize(s.BlockWrite)),
+		PIDs:     fmt.Sprintf("%d", s.PidsCurrent),
+	}, nil
+}
+
+// StatsFormatter renders a single containerStats snapshot into one output row.
+type StatsFormatter interface {
+	Format(s *containerStats) (string, error)
+}
+
+type tableFormatter struct{}
+
+func (tableFormatter) Format(s *containerStats) (string, error) {
+	f, err := s.fields()
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+		f.Name, f.CPUPerc, f.MemUsage, f.MemPerc, f.NetIO, f.BlockIO, f.PIDs), nil
+}
+
+// templateFormatter renders a row from a user-supplied text/template.
+type templateFormatter struct {
+	tmpl *template.Template
+}
+
+func (f *templateFormatter) Format(s *containerStats) (string, error) {
+	fields, err := s.fields()
+	if err != nil {
+		return "", err
+	}
+	var buf strings.Builder
+	if err := f.tmpl.Execute(&buf, fields); err != nil {
+		return "", err
+	}
+	return buf.String() + "\n", nil
+}
+
+type jsonFormatter struct{}
+
+func (jsonFormatter) Format(s *containerStats) (string, error) {
+	fields, err := s.fields()
+	if err != nil {
+		return "", err
+	}
+	b, err := json.Marshal(fields)
+	if err != nil {
+		return "", err
+	}
+	return string(b) + "\n", nil
+}
+
+// containerMetrics is a numeric snapshot of a containerStats for the
+// Prometheus exporter, which needs raw values rather than statsFields'
+// pre-formatted display strings.
+type containerMetrics struct {
+	Name        string
+	available   bool
+	CPU         float64
+	Memory      float64
+	MemoryLimit float64
+	NetworkRx   float64
+	NetworkTx   float64
+	BlockRead   float64
+	BlockWrite  float64
+	PidsCurrent uint64
+}
+
+func (s *containerStats) metrics() containerMetrics {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return containerMetrics{
+		Name:        s.Name,
+		available:   s.err == nil && !s.unavailable,
+		CPU:         s.CPUPercentage,
+		Memory:      s.Memory,
+		MemoryLimit: s.MemoryLimit,
+		NetworkRx:   s.NetworkRx,
+		NetworkTx:   s.NetworkTx,
+		BlockRead:   s.BlockRead,
+		BlockWrite:  s.BlockWrite,
+		PidsCurrent: s.PidsCurrent,
+	}
+}
+
+func writePrometheusMetrics(w io.Writer, all []*containerStats) {
+	metrics := make([]containerMetrics, 0, len(all))
+	for _, c := range all {
+		if m := c.metrics(); m.available {
+			metrics = append(metrics, m)
+		}
+	}
+	writeGauge(w, "container_cpu_percent", "Percentage of host CPU used by the container.", metrics,
+		func(m containerMetrics) float64 { return m.CPU })
+	writeGauge(w, "container_memory_usage_bytes", "Memory usage of the container, in bytes.", metrics,
+		func(m containerMetrics) float64 { return m.Memory })
+	writeGauge(w, "container_memory_limit_bytes", "Memory limit of the container, in bytes.", metrics,
+		func(m containerMetrics) float64 { return m.MemoryLimit })
+	writeCounter(w, "container_network_receive_bytes_total", "Total bytes received on the container's network interfaces.", metrics,
+		func(m containerMetrics) float64 { return m.NetworkRx })
+	writeCounter(w, "container_network_transmit_bytes_total", "Total bytes transmitted on the container's network interfaces.", metrics,
+		func(m containerMetrics) float64 { return m.NetworkTx })
+	writeCounter(w, "container_block_read_bytes_total", "Total bytes read from block devices by the container.", metrics,
+		func(m containerMetrics) float64 { return m.BlockRead })
+	writeCounter(w, "container_block_write_bytes_total", "Total bytes written to block devices by the container.", metrics,
+		func(m containerMetrics) float64 { return m.BlockWrite })
+	writeGauge(w, "container_pids", "Number of PIDs currently used by the container.", metrics,
+		func(m containerMetrics) float64 { return float64(m.PidsCurrent) })
+}
+
+func writeGauge(w io.Writer, name, help string, metrics []containerMetrics, value func(containerMetrics) float64) {
+	writeMetric(w, name, help, "gauge", metrics, value)
+}
+
+func writeCounter(w io.Writer, name, help string, metrics []containerMetrics, value func(containerMetrics) float64) {
+	writeMetric(w, name, help, "counter", metrics, value)
+}
+
+func writeMetric(w io.Writer, name, help, typ string, metrics []containerMetrics, value func(containerMetrics) float64) {
+	fmt.Fprintf(w, "# HELP %s %s\n", name, help)
+	fmt.Fprintf(w, "# TYPE %s %s\n", name, typ)
+	for _, m := range metrics {
+		fmt.Fprintf(w, "%s{name=%q} %v\n", name, m.Name, value(m))
 	}
-	fmt.Fprintf(w, "%s\t%.2f%%\t%s/%s\t%.2f%%\t%s/%s\n",
-		s.Name,
-		s.CPUPercentage,
-		units.HumanSize(s.Memory), units.HumanSize(s.MemoryLimit),
-		s.MemoryPercentage,
-		units.HumanSize(s.NetworkRx), units.HumanSize(s.NetworkTx))
-	return nil
 }
 
 // CmdStats displays a live stream of resource usage statistics for one or more containers.
 //
 // This shows real-time information on CPU usage, memory usage, and network I/O.
 //
-// Usage: docker stats CONTAINER [CONTAINER...]
+// Usage: docker stats [OPTIONS] [CONTAINER...]
 func (cli *DockerCli) CmdStats(args ...string) error {
-	cmd := cli.Subcmd("stats", "CONTAINER [CONTAINER...]", "Display a live stream of one or more containers' resource usage statistics", true)
-	cmd.Require(flag.Min, 1)
+	cmd := cli.Subcmd("stats", "[OPTIONS] [CONTAINER...]", "Display a live stream of container(s) resource usage statistics", true)
+	all := cmd.Bool([]string{"a", "-all"}, false, "Show all containers, including stopped ones, and watch for new ones")
+	noStream := cmd.Bool([]string{"-no-stream"}, false, "Disable streaming stats and only pull the first result")
+	format := cmd.String([]string{"-format"}, "", "Pretty-print stats using a Go template, or 'json'")
+	serveAddr := cmd.String([]string{"-serve"}, "", "Serve the live metrics as Prometheus text exposition format at /metrics on the given address, instead of rendering to the terminal")
+	rawMemory := cmd.Bool([]string{"-raw-memory"}, false, "Report raw cgroup memory usage, including page cache, instead of excluding it")
 	cmd.ParseFlags(args, true)
 
 	names := cmd.Args()
 	sort.Strings(names)
+	if len(names) == 0 && !*all {
+		return fmt.Errorf("docker stats requires at least 1 argument(s), unless --all is given")
+	}
+
+	var formatter StatsFormatter
+	switch *format {
+	case "":
+		formatter = tableFormatter{}
+	case "json":
+		formatter = jsonFormatter{}
+	default:
+		tmpl, err := template.New("").Parse(*format)
+		if err != nil {
+			return fmt.Errorf("Template parsing error: %v", err)
+		}
+		formatter = &templateFormatter{tmpl: tmpl}
+	}
+	_, isTable := formatter.(tableFormatter)
+
 	var (
-		cStats []*containerStats
+		s      = &stats{}
+		done   = make(map[string]chan bool)
+		doneMu sync.Mutex
 		w      = tabwriter.NewWriter(cli.out, 20, 1, 3, ' ', 0)
 	)
 	printHeader := func() {
+		if !isTable {
+			return
+		}
 		io.WriteString(cli.out, "\033[2J")
 		io.WriteString(cli.out, "\033[H")
-		io.WriteString(w, "CONTAINER\tCPU %\tMEM USAGE/LIMIT\tMEM %\tNET I/O\n")
+		io.WriteString(w, "CONTAINER\tCPU %\tMEM USAGE/LIMIT\tMEM %\tNET I/O\tBLOCK I/O\tPIDS\n")
+	}
+
+	startCollectingWithID := func(name, id string) {
+		if !s.add(&containerStats{Name: name, ID: id}) {
+			return
+		}
+		d := make(chan bool)
+		doneMu.Lock()
+		done[name] = d
+		doneMu.Unlock()
+		for _, c := range s.list() {
+			if c.Name == name {
+				go c.Collect(cli, d, *rawMemory)
+				break
+			}
+		}
+	}
+
+	// startCollecting is used for identifiers that are already a full
+	// container ID (discovered via /containers/json or an events callback).
+	startCollecting := func(id string) {
+		startCollectingWithID(id, id)
+	}
+
+	// startCollectingByName is used for CLI-provided container arguments,
+	// which may be a name rather than an ID. It resolves the ID so a later
+	// events callback (which only ever reports IDs) is recognized as the
+	// same container instead of being added a second time.
+	startCollectingByName := func(name string) {
+		id := name
+		if body, _, err := cli.call("GET", "/containers/"+name+"/json", nil, nil); err == nil {
+			var c struct {
+				ID string `json:"Id"`
+			}
+			if json.NewDecoder(body).Decode(&c) == nil && c.ID != "" {
+				id = c.ID
+			}
+			body.Close()
+		}
+		startCollectingWithID(name, id)
 	}
+
+	stopCollecting := func(id string) {
+		name, exists := s.nameFor(id)
+		if !exists {
+			return
+		}
+		doneMu.Lock()
+		if d, exists := done[name]; exists {
+			close(d)
+			delete(done, name)
+		}
+		doneMu.Unlock()
+		s.remove(name)
+	}
+
 	for _, n := range names {
-		s := &containerStats{Name: n}
-		cStats = append(cStats, s)
-		go s.Collect(cli)
+		startCollectingByName(n)
 	}
+
+	if *all || len(names) == 0 {
+		query := ""
+		if *all {
+			query = "?all=1"
+		}
+		body, _, err := cli.call("GET", "/containers/json"+query, nil, nil)
+		if err != nil {
+			return err
+		}
+		var running []struct {
+			ID string `json:"Id"`
+		}
+		err = json.NewDecoder(body).Decode(&running)
+		body.Close()
+		if err != nil {
+			return err
+		}
+		for _, c := range running {
+			startCollecting(c.ID)
+		}
+
+		eventq, _, err := cli.call("GET", "/events", nil, nil)
+		if err != nil {
+			return err
+		}
+		go func() {
+			defer eventq.Close()
+			dec := json.NewDecoder(eventq)
+			for {
+				var event struct {
+					Status string `json:"status"`
+					ID     string `json:"id"`
+				}
+				if err := dec.Decode(&event); err != nil {
+					return
+				}
+				switch event.Status {
+				case "start":
+					startCollecting(event.ID)
+				case "die", "destroy":
+					stopCollecting(event.ID)
+				}
+			}
+		}()
+	}
+
+	if *serveAddr != "" {
+		mux := http.NewServeMux()
+		mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+			writePrometheusMetrics(w, s.list())
+		})
+		return http.ListenAndServe(*serveAddr, mux)
+	}
+
 	// do a quick pause so that any failed connections for containers that do not exist are able to be
 	// evicted before we display the initial or default values.
 	time.Sleep(500 * time.Millisecond)
 	var errs []string
-	for _, c := range cStats {
+	for _, c := range s.list() {
 		c.mu.Lock()
 		if c.err != nil {
 			errs = append(errs, fmt.Sprintf("%s: %v", c.Name, c.err))
 		}
 		c.mu.Unlock()
 	}
-	if len(errs) > 0 {
+	if len(errs) > 0 && len(names) > 0 {
 		return fmt.Errorf("%s", strings.Join(errs, ", "))
 	}
-	for _ = range time.Tick(500 * time.Millisecond) {
+	for {
 		printHeader()
-		toRemove := []int{}
-		for i, s := range cStats {
-			if err := s.Display(w); err != nil {
-				toRemove = append(toRemove, i)
+		for _, c := range s.list() {
+			row, err := formatter.Format(c)
+			if err != nil {
+				stopCollecting(c.Name)
+				continue
+			}
+			if isTable {
+				io.WriteString(w, row)
+			} else {
+				io.WriteString(cli.out, row)
 			}
 		}
-		for j := len(toRemove) - 1; j >= 0; j-- {
-			i := toRemove[j]
-			cStats = append(cStats[:i], cStats[i+1:]...)
+		if isTable {
+			w.Flush()
+		}
+		if *noStream {
+			return nil
 		}
-		if len(cStats) == 0 {
+		if len(s.list()) == 0 && len(names) > 0 {
 			return nil
 		}
-		w.Flush()
+		<-time.After(500 * time.Millisecond)
 	}
-	return nil
 }
 
-func calculateCPUPercent(previousCPU, previousSystem uint64, v *types.Stats) float64 {
+// calculateCPUPercentUnix computes CPU% the cgroup way: the container's
+// share of the delta in total system CPU time since the last reading,
+// scaled by the number of CPUs available to it. OnlineCPUs is preferred
+// since it's accurate under cgroup v2; len(PercpuUsage) and runtime.NumCPU()
+// are fallbacks for hosts that don't report it.
+func calculateCPUPercentUnix(previousCPU, previousSystem uint64, cpuStats *types.CPUStats) float64 {
 	var (
-		cpuPercent = 0.0
-		// calculate the change for the cpu usage of the container in between readings
-		cpuDelta = float64(v.CpuStats.CpuUsage.TotalUsage - previousCPU)
-		// calculate the change for the entire system between readings
-		systemDelta = float64(v.CpuStats.SystemUsage - previousSystem)
+		cpuPercent  = 0.0
+		cpuDelta    = float64(cpuStats.CpuUsage.TotalUsage) - float64(previousCPU)
+		systemDelta = float64(cpuStats.SystemUsage) - float64(previousSystem)
+		onlineCPUs  = float64(cpuStats.OnlineCPUs)
 	)
+	if onlineCPUs == 0.0 {
+		if len(cpuStats.CpuUsage.PercpuUsage) > 0 {
+			onlineCPUs = float64(len(cpuStats.CpuUsage.PercpuUsage))
+		} else {
+			onlineCPUs = float64(runtime.NumCPU())
+		}
+	}
+	if systemDelta > 0.0 && cpuDelta > 0.0 {
+		cpuPercent = (cpuDelta / systemDelta) * onlineCPUs * 100.0
+	}
+	return cpuPercent
+}
 
+// calculateCPUPercentWindows is the calculateCPUPercentUnix equivalent for
+// Windows containers, which report HCS-style ReadTime/KernelTime/UserTime
+// counters instead of the cgroup usage/system counters.
+func calculateCPUPercentWindows(previousCPU, previousSystem uint64, cpuStats *types.CPUStats) float64 {
+	var (
+		cpuPercent  = 0.0
+		newCPU      = cpuStats.KernelTime + cpuStats.UserTime
+		cpuDelta    = float64(newCPU) - float64(previousCPU)
+		systemDelta = float64(cpuStats.ReadTime) - float64(previousSystem)
+	)
 	if systemDelta > 0.0 && cpuDelta > 0.0 {
-		cpuPercent = (cpuDelta / systemDelta) * float64(len(v.CpuStats.CpuUsage.PercpuUsage)) * 100.0
+		cpuPercent = (cpuDelta / systemDelta) * 100.0
 	}
 	return cpuPercent
 }
+
+// calculateMemUsageUnixNoCache subtracts the kernel's page cache from the
+// raw cgroup usage counter, tracked under total_inactive_file on cgroup v1
+// and inactive_file on cgroup v2, so idle containers don't appear to be
+// using nearly all of their memory limit on modern kernels.
+func calculateMemUsageUnixNoCache(mem types.MemoryStats) float64 {
+	if v, isCgroup1 := mem.Stats["total_inactive_file"]; isCgroup1 {
+		if v > mem.Usage {
+			return 0
+		}
+		return float64(mem.Usage - v)
+	}
+	if v, isCgroup2 := mem.Stats["inactive_file"]; isCgroup2 {
+		if v > mem.Usage {
+			return 0
+		}
+		return float64(mem.Usage - v)
+	}
+	return float64(mem.Usage)
+}
+
+func calculateBlockIO(blkio types.BlkioStats) (blkRead uint64, blkWrite uint64) {
+	for _, bioEntry := range blkio.IoServiceBytesRecursive {
+		switch strings.ToLower(bioEntry.Op) {
+		case "read":
+			blkRead = blkRead + bioEntry.Value
+		case "write":
+			blkWrite = blkWrite + bioEntry.Value
+		}
+	}
+	return
+}
@@ -0,0 +1,171 @@
+package client
+
+import (
+	"testing"
+
+	"github.com/docker/docker/api/types"
+)
+
+func TestCalculateBlockIO(t *testing.T) {
+	cases := []struct {
+		name        string
+		entries     []types.BlkioStatEntry
+		read, write uint64
+	}{
+		{"empty", nil, 0, 0},
+		{
+			"single device",
+			[]types.BlkioStatEntry{
+				{Op: "Read", Value: 100},
+				{Op: "Write", Value: 50},
+			},
+			100, 50,
+		},
+		{
+			"summed across devices, case-insensitive op",
+			[]types.BlkioStatEntry{
+				{Op: "read", Value: 10},
+				{Op: "Read", Value: 20},
+				{Op: "write", Value: 5},
+				{Op: "Write", Value: 7},
+				{Op: "total", Value: 42},
+			},
+			30, 12,
+		},
+	}
+	for _, c := range cases {
+		read, write := calculateBlockIO(types.BlkioStats{IoServiceBytesRecursive: c.entries})
+		if read != c.read || write != c.write {
+			t.Errorf("%s: got read=%d write=%d, want read=%d write=%d", c.name, read, write, c.read, c.write)
+		}
+	}
+}
+
+func TestCalculateCPUPercentUnix(t *testing.T) {
+	cases := []struct {
+		name                        string
+		previousCPU, previousSystem uint64
+		cpuStats                    types.CPUStats
+		want                        float64
+	}{
+		{
+			name:           "uses OnlineCPUs",
+			previousCPU:    0,
+			previousSystem: 0,
+			cpuStats: types.CPUStats{
+				CpuUsage:    types.CPUUsage{TotalUsage: 20},
+				SystemUsage: 100,
+				OnlineCPUs:  2,
+			},
+			want: 40.0,
+		},
+		{
+			name:           "falls back to PercpuUsage count when OnlineCPUs is zero",
+			previousCPU:    0,
+			previousSystem: 0,
+			cpuStats: types.CPUStats{
+				CpuUsage:    types.CPUUsage{TotalUsage: 10, PercpuUsage: []uint64{1, 2, 3, 4}},
+				SystemUsage: 100,
+			},
+			want: 40.0,
+		},
+		{
+			name:           "no usage delta is 0%",
+			previousCPU:    50,
+			previousSystem: 100,
+			cpuStats: types.CPUStats{
+				CpuUsage:    types.CPUUsage{TotalUsage: 50},
+				SystemUsage: 200,
+				OnlineCPUs:  4,
+			},
+			want: 0,
+		},
+		{
+			name:           "no system delta is 0%",
+			previousCPU:    10,
+			previousSystem: 100,
+			cpuStats: types.CPUStats{
+				CpuUsage:    types.CPUUsage{TotalUsage: 50},
+				SystemUsage: 100,
+				OnlineCPUs:  4,
+			},
+			want: 0,
+		},
+	}
+	for _, c := range cases {
+		got := calculateCPUPercentUnix(c.previousCPU, c.previousSystem, &c.cpuStats)
+		if got != c.want {
+			t.Errorf("%s: got %v, want %v", c.name, got, c.want)
+		}
+	}
+}
+
+func TestCalculateCPUPercentWindows(t *testing.T) {
+	cases := []struct {
+		name                        string
+		previousCPU, previousSystem uint64
+		cpuStats                    types.CPUStats
+		want                        float64
+	}{
+		{
+			name:           "kernel+user share of elapsed read time",
+			previousCPU:    0,
+			previousSystem: 0,
+			cpuStats:       types.CPUStats{KernelTime: 10, UserTime: 10, ReadTime: 100},
+			want:           20.0,
+		},
+		{
+			name:           "counters going backward does not wrap around",
+			previousCPU:    1000,
+			previousSystem: 2000,
+			cpuStats:       types.CPUStats{KernelTime: 5, UserTime: 5, ReadTime: 100},
+			want:           0,
+		},
+	}
+	for _, c := range cases {
+		got := calculateCPUPercentWindows(c.previousCPU, c.previousSystem, &c.cpuStats)
+		if got != c.want {
+			t.Errorf("%s: got %v, want %v", c.name, got, c.want)
+		}
+	}
+}
+
+func TestCalculateMemUsageUnixNoCache(t *testing.T) {
+	cases := []struct {
+		name string
+		mem  types.MemoryStats
+		want float64
+	}{
+		{
+			name: "cgroup v1 subtracts total_inactive_file",
+			mem:  types.MemoryStats{Usage: 100, Stats: map[string]uint64{"total_inactive_file": 40}},
+			want: 60,
+		},
+		{
+			name: "cgroup v2 subtracts inactive_file",
+			mem:  types.MemoryStats{Usage: 100, Stats: map[string]uint64{"inactive_file": 40}},
+			want: 60,
+		},
+		{
+			name: "fully-cached idle container clamps at zero rather than returning raw usage",
+			mem:  types.MemoryStats{Usage: 100, Stats: map[string]uint64{"total_inactive_file": 150}},
+			want: 0,
+		},
+		{
+			name: "cache equal to usage clamps at zero",
+			mem:  types.MemoryStats{Usage: 100, Stats: map[string]uint64{"total_inactive_file": 100}},
+			want: 0,
+		},
+		{
+			name: "no cache key present returns raw usage",
+			mem:  types.MemoryStats{Usage: 100, Stats: map[string]uint64{}},
+			want: 100,
+		},
+	}
+	for _, c := range cases {
+		got := calculateMemUsageUnixNoCache(c.mem)
+		if got != c.want {
+			t.Errorf("%s: got %v, want %v", c.name, got, c.want)
+		}
+	}
+}